@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// changelogModeGit triggers git-log based changelog generation when
+// changelog_file_list is empty.
+const changelogModeGit = "git"
+
+// conventionalCommitTypes defines the canonical ordering in which commit
+// types are grouped in the generated changelog. Commits that don't match any
+// of these are bucketed under "other".
+var conventionalCommitTypes = []string{"feat", "fix", "chore", "docs", "style", "refactor", "perf", "test", "build", "ci", "revert"}
+
+var conventionalCommitRegexp = regexp.MustCompile(`^(` + strings.Join(conventionalCommitTypes, "|") + `)(\([^)]*\))?:\s*(.*)$`)
+
+const defaultChangelogTemplate = `## Changelog
+{{range .Groups}}
+### {{.Type}}
+{{range .Entries}}- {{.Subject}} ({{.ShortSHA}}) - {{.Author}}
+{{end}}
+{{end}}`
+
+type changelogEntry struct {
+	ShortSHA string
+	Subject  string
+	Author   string
+	Type     string
+}
+
+type changelogGroup struct {
+	Type    string
+	Entries []changelogEntry
+}
+
+type changelogData struct {
+	Tag         string
+	PreviousTag string
+	Groups      []changelogGroup
+}
+
+// previousTag infers the tag preceding tag by asking git to describe the
+// commit before it.
+func previousTag(tag string) (string, error) {
+	out, err := exec.Command("git", "describe", "--tags", "--abbrev=0", tag+"^").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// changelogEntries lists the commits between previousTag and tag (or all
+// commits reachable by tag when previousTag is empty).
+func changelogEntries(previousTag string, tag string) ([]changelogEntry, error) {
+	commitRange := tag
+	if previousTag != "" {
+		commitRange = previousTag + ".." + tag
+	}
+
+	out, err := exec.Command("git", "log", commitRange, "--pretty=format:%h%x1f%s%x1f%an").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []changelogEntry
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 3 {
+			continue
+		}
+
+		entry := changelogEntry{
+			ShortSHA: fields[0],
+			Subject:  fields[1],
+			Author:   fields[2],
+			Type:     "other",
+		}
+
+		if match := conventionalCommitRegexp.FindStringSubmatch(entry.Subject); match != nil {
+			entry.Type = match[1]
+			entry.Subject = match[3]
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// groupChangelogEntries buckets entries by conventional-commit type,
+// preserving the canonical type ordering and dropping empty groups.
+func groupChangelogEntries(entries []changelogEntry) []changelogGroup {
+	byType := make(map[string][]changelogEntry)
+	for _, entry := range entries {
+		byType[entry.Type] = append(byType[entry.Type], entry)
+	}
+
+	var groups []changelogGroup
+	for _, commitType := range append(append([]string{}, conventionalCommitTypes...), "other") {
+		if entries, ok := byType[commitType]; ok {
+			groups = append(groups, changelogGroup{Type: commitType, Entries: entries})
+		}
+	}
+
+	return groups
+}
+
+// renderChangelog parses tmplText (or the built-in default when empty) as a
+// Go text/template and executes it against the grouped changelog data.
+func renderChangelog(tmplText string, tag string, previousTag string, groups []changelogGroup) (string, error) {
+	if tmplText == "" {
+		tmplText = defaultChangelogTemplate
+	}
+
+	tmpl, err := template.New("changelog").Parse(tmplText)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	data := changelogData{Tag: tag, PreviousTag: previousTag, Groups: groups}
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// generateChangelog derives a Markdown changelog from the git log between
+// the release tag and the tag preceding it.
+func generateChangelog(config ConfigModel) (string, error) {
+	if config.ReleaseTag == "" {
+		return "", errors.New("release_tag is required to generate a changelog")
+	}
+
+	prevTag, err := previousTag(config.ReleaseTag)
+	if err != nil {
+		log.Warnf("Could not determine previous tag, changelog will include the full history: %v", err)
+		prevTag = ""
+	}
+
+	entries, err := changelogEntries(prevTag, config.ReleaseTag)
+	if err != nil {
+		return "", err
+	}
+
+	groups := groupChangelogEntries(entries)
+
+	return renderChangelog(config.ChangelogTemplate, config.ReleaseTag, prevTag, groups)
+}
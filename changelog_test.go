@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestGroupChangelogEntries(t *testing.T) {
+	entries := []changelogEntry{
+		{ShortSHA: "a1", Subject: "add widgets", Author: "alice", Type: "feat"},
+		{ShortSHA: "b2", Subject: "fix crash", Author: "bob", Type: "fix"},
+		{ShortSHA: "c3", Subject: "add gadgets", Author: "alice", Type: "feat"},
+		{ShortSHA: "d4", Subject: "tidy up", Author: "carol", Type: "other"},
+	}
+
+	groups := groupChangelogEntries(entries)
+
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d: %+v", len(groups), groups)
+	}
+
+	// Canonical ordering: feat before fix, recognized types before "other".
+	if groups[0].Type != "feat" || len(groups[0].Entries) != 2 {
+		t.Errorf("expected first group to be feat with 2 entries, got %+v", groups[0])
+	}
+	if groups[1].Type != "fix" || len(groups[1].Entries) != 1 {
+		t.Errorf("expected second group to be fix with 1 entry, got %+v", groups[1])
+	}
+	if groups[2].Type != "other" || len(groups[2].Entries) != 1 {
+		t.Errorf("expected last group to be other with 1 entry, got %+v", groups[2])
+	}
+}
+
+func TestGroupChangelogEntriesEmpty(t *testing.T) {
+	if groups := groupChangelogEntries(nil); groups != nil {
+		t.Errorf("expected no groups for no entries, got %+v", groups)
+	}
+}
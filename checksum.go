@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumAlgos maps the supported `checksum` input values to their hash
+// constructors, mirroring the algorithms offered by the drone-gitea-release
+// plugin.
+var checksumAlgos = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha1":    sha1.New,
+	"sha256":  sha256.New,
+	"sha512":  sha512.New,
+	"adler32": func() hash.Hash { return adler32.New() },
+	"crc32":   func() hash.Hash { return crc32.NewIEEE() },
+}
+
+// parseChecksumAlgos parses the comma-separated `checksum` input, e.g.
+// "sha256,sha512".
+func parseChecksumAlgos(list string) ([]string, error) {
+	var algos []string
+	for _, algo := range strings.Split(list, ",") {
+		algo = strings.TrimSpace(algo)
+		if algo == "" {
+			continue
+		}
+		if _, ok := checksumAlgos[algo]; !ok {
+			return nil, errors.New("unsupported checksum algorithm: " + algo)
+		}
+		algos = append(algos, algo)
+	}
+	return algos, nil
+}
+
+// checksumFile streams assetPath through the named hash algorithm and
+// returns its hex digest without loading the whole file into memory.
+func checksumFile(assetPath string, algo string) (string, error) {
+	newHash, ok := checksumAlgos[algo]
+	if !ok {
+		return "", errors.New("unsupported checksum algorithm: " + algo)
+	}
+
+	file, err := os.Open(assetPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// writeChecksumFiles computes, for every requested algorithm, the digests of
+// all assetPaths and writes them to a `<algo>sums.txt` file in the standard
+// `<hex>  <basename>` format. It returns the paths of the generated files so
+// they can be uploaded alongside the other release assets.
+func writeChecksumFiles(assetPaths []string, algos []string) ([]string, error) {
+	var checksumFiles []string
+
+	for _, algo := range algos {
+		sumsPath := algo + "sums.txt"
+		sumsFile, err := os.Create(sumsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, assetPath := range assetPaths {
+			digest, err := checksumFile(assetPath, algo)
+			if err != nil {
+				sumsFile.Close()
+				return nil, err
+			}
+
+			if _, err := fmt.Fprintf(sumsFile, "%s  %s\n", digest, filepath.Base(assetPath)); err != nil {
+				sumsFile.Close()
+				return nil, err
+			}
+		}
+
+		if err := sumsFile.Close(); err != nil {
+			return nil, err
+		}
+
+		checksumFiles = append(checksumFiles, sumsPath)
+	}
+
+	return checksumFiles, nil
+}
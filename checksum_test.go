@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseChecksumAlgos(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "single algo", list: "sha256", want: []string{"sha256"}},
+		{name: "comma separated", list: "sha256,sha512", want: []string{"sha256", "sha512"}},
+		{name: "whitespace around commas", list: "md5, sha1 , crc32", want: []string{"md5", "sha1", "crc32"}},
+		{name: "empty input", list: "", want: nil},
+		{name: "unsupported algo", list: "sha256,sha3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseChecksumAlgos(tt.list)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseChecksumAlgos(%q) expected an error, got none", tt.list)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseChecksumAlgos(%q) returned unexpected error: %v", tt.list, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChecksumAlgos(%q) = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
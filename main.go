@@ -2,68 +2,76 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"io/ioutil"
-	"mime"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/bitrise-io/go-utils/log"
+	"github.com/google/go-github/v48/github"
+	"golang.org/x/oauth2"
 )
 
 type ConfigModel struct {
 	GitHubAuthToken   string
 	RepositoryURL     string
+	BaseURL           string
+	UploadURL         string
 	ChangelogFileList string
+	ChangelogMode     string
+	ChangelogTemplate string
 	ReleaseTag        string
 	ReleaseName       string
 	TargetCommitish   string
 	IsDraft           bool
-	IsPrerelease      bool
-	UploadAssetFile   string
+	IsPrerelease      string
+	OnlyOnTag         string
+	UploadAssetFiles  string
+	FileExists        string
+	UpdateExisting    bool
+	Checksum          string
 }
 
-type GitHubApiConfig struct {
-	User      string
-	Repo      string
-	AuthToken string
-}
+// Supported values for the file_exists input, mirroring the collision
+// policy offered by the drone-gitea-release plugin.
+const (
+	fileExistsOverwrite = "overwrite"
+	fileExistsSkip      = "skip"
+	fileExistsFail      = "fail"
+)
 
-type GitHubRelease struct {
-	ID              int    `json:"id,omitempty"`
-	TagName         string `json:"tag_name,omitempty"`
-	Name            string `json:"name,omitempty"`
-	TargetCommitish string `json:"target_commitish,omitempty"`
-	Body            string `json:"body,omitempty"`
-	Draft           bool   `json:"draft,omitempty"`
-	Prerelease      bool   `json:"prerelease,omitempty"`
-	UploadURL       string `json:"upload_url,omitempty"`
-	HTMLURL         string `json:"html_url,omitempty"`
+type GitHubApiConfig struct {
+	User   string
+	Repo   string
+	Client *github.Client
 }
 
 var gitAPIRegexp = regexp.MustCompile(`([A-Za-z0-9]+@|http(|s)\:\/\/)([A-Za-z0-9.-]+)(:|\/)([^.]+)\/([^.]+)(\.git)?`)
 
-const gitHubBaseURL = "https://api.github.com"
-const gitHubUploadURL = "https://uploads.github.com"
-const defaultMediaType = "application/octet-stream"
-
 func createConfigsModelFromEnvs() ConfigModel {
 	return ConfigModel{
 		GitHubAuthToken:   os.Getenv("github_auth_token"),
 		RepositoryURL:     os.Getenv("repository_url"),
+		BaseURL:           os.Getenv("base_url"),
+		UploadURL:         os.Getenv("upload_url"),
 		ChangelogFileList: os.Getenv("changelog_file_list"),
+		ChangelogMode:     os.Getenv("changelog_mode"),
+		ChangelogTemplate: os.Getenv("changelog_template"),
 		ReleaseTag:        os.Getenv("release_tag"),
 		ReleaseName:       os.Getenv("release_name"),
 		TargetCommitish:   os.Getenv("target_commitish"),
 		IsDraft:           os.Getenv("is_draft") == "true",
-		IsPrerelease:      os.Getenv("is_prerelease") == "true",
-		UploadAssetFile:   os.Getenv("upload_asset_file"),
+		IsPrerelease:      os.Getenv("is_prerelease"),
+		OnlyOnTag:         os.Getenv("only_on_tag"),
+		UploadAssetFiles:  os.Getenv("upload_asset_file"),
+		FileExists:        os.Getenv("file_exists"),
+		UpdateExisting:    os.Getenv("update_existing") == "true",
+		Checksum:          os.Getenv("checksum"),
 	}
 }
 
@@ -71,33 +79,45 @@ func (configs ConfigModel) print() {
 	log.Infof("Configs:")
 	log.Printf("- GitHubAuthToken: %s", configs.GitHubAuthToken)
 	log.Printf("- RepositoryURL: %s", configs.RepositoryURL)
+	log.Printf("- BaseURL: %s", configs.BaseURL)
+	log.Printf("- UploadURL: %s", configs.UploadURL)
 	log.Printf("- ChangelogFileList: %s", configs.ChangelogFileList)
+	log.Printf("- ChangelogMode: %s", configs.ChangelogMode)
+	log.Printf("- ChangelogTemplate: %s", configs.ChangelogTemplate)
 	log.Printf("- ReleaseTag: %s", configs.ReleaseTag)
 	log.Printf("- ReleaseName: %s", configs.ReleaseName)
 	log.Printf("- TargetCommitish: %s", configs.TargetCommitish)
 	log.Printf("- IsDraft: %v", configs.IsDraft)
-	log.Printf("- IsPrerelease: %v", configs.IsPrerelease)
-	log.Printf("- UploadAssetFile: %v", configs.UploadAssetFile)
+	log.Printf("- IsPrerelease: %s", configs.IsPrerelease)
+	log.Printf("- OnlyOnTag: %s", configs.OnlyOnTag)
+	log.Printf("- UploadAssetFiles: %v", configs.UploadAssetFiles)
+	log.Printf("- FileExists: %v", configs.FileExists)
+	log.Printf("- UpdateExisting: %v", configs.UpdateExisting)
+	log.Printf("- Checksum: %s", configs.Checksum)
 }
 
 func (apiConfig GitHubApiConfig) print() {
 	log.Infof("ApiConfig:")
 	log.Printf("- User: %s", apiConfig.User)
 	log.Printf("- Repository: %s", apiConfig.Repo)
-	log.Printf("- AuthToken: %s", apiConfig.AuthToken)
 }
 
-func (apiConfig GitHubApiConfig) getCreateReleasesURL() string {
-	return gitHubBaseURL +
-		"/repos/" + apiConfig.User + "/" + apiConfig.Repo +
-		"/releases?access_token=" + apiConfig.AuthToken
-}
+// newGitHubClient builds an oauth2-authenticated go-github client. When
+// BaseURL/UploadURL are set it targets a GitHub Enterprise Server instance
+// instead of github.com.
+func newGitHubClient(config ConfigModel) (*github.Client, error) {
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.GitHubAuthToken})
+	httpClient := oauth2.NewClient(context.Background(), tokenSource)
+
+	if config.BaseURL != "" || config.UploadURL != "" {
+		uploadURL := config.UploadURL
+		if uploadURL == "" {
+			uploadURL = config.BaseURL
+		}
+		return github.NewEnterpriseClient(config.BaseURL, uploadURL, httpClient)
+	}
 
-func (apiConfig GitHubApiConfig) getUploadAssetURL(releaseId int, name string) string {
-	return gitHubUploadURL +
-		"/repos/" + apiConfig.User + "/" + apiConfig.Repo +
-		"/releases/" + strconv.Itoa(releaseId) + "/assets?access_token=" + apiConfig.AuthToken +
-		"&name=" + name
+	return github.NewClient(httpClient), nil
 }
 
 func inferGithubAPIConfig(config ConfigModel) (GitHubApiConfig, error) {
@@ -108,10 +128,15 @@ func inferGithubAPIConfig(config ConfigModel) (GitHubApiConfig, error) {
 		return apiConf, errors.New("error: User and Repo could not be obtained")
 	}
 
+	client, err := newGitHubClient(config)
+	if err != nil {
+		return apiConf, err
+	}
+
 	apiConf = GitHubApiConfig{
-		User:      match[5],
-		Repo:      match[6],
-		AuthToken: config.GitHubAuthToken,
+		User:   match[5],
+		Repo:   match[6],
+		Client: client,
 	}
 	return apiConf, nil
 }
@@ -136,126 +161,278 @@ func collectReleaseNotes(files string) string {
 	return buffer.String()
 }
 
+func splitList(list string) []string {
+	var items []string
+	for _, item := range regexp.MustCompile(`[\n|]`).Split(list, -1) {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func resolveAssetPaths(patterns string) ([]string, error) {
+	var paths []string
+	for _, pattern := range splitList(patterns) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, errors.New("no file found for pattern: " + pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
 func failf(format string, v ...interface{}) {
 	log.Errorf(format, v...)
 	os.Exit(1)
 }
 
-func createRelease(config ConfigModel, releaseNotes string) GitHubRelease {
-	return GitHubRelease{
-		Name:            config.ReleaseName,
-		TagName:         config.ReleaseTag,
-		Draft:           config.IsDraft,
-		Prerelease:      config.IsPrerelease,
-		TargetCommitish: config.TargetCommitish,
-		Body:            releaseNotes,
+func createRelease(config ConfigModel, releaseNotes string, isPrerelease bool) github.RepositoryRelease {
+	return github.RepositoryRelease{
+		Name:            &config.ReleaseName,
+		TagName:         &config.ReleaseTag,
+		Draft:           &config.IsDraft,
+		Prerelease:      &isPrerelease,
+		TargetCommitish: &config.TargetCommitish,
+		Body:            &releaseNotes,
 	}
 }
 
-func postAsset(apiConf GitHubApiConfig, release *GitHubRelease, postAsset *os.File) error {
-	defer postAsset.Close()
+// listReleaseAssets fetches every asset on the release, following pagination.
+func listReleaseAssets(ctx context.Context, apiConf GitHubApiConfig, releaseID int64) ([]*github.ReleaseAsset, error) {
+	var allAssets []*github.ReleaseAsset
 
-	stat, err := postAsset.Stat()
-	if err != nil {
-		return err
+	opt := &github.ListOptions{PerPage: 100}
+	for {
+		assets, resp, err := apiConf.Client.Repositories.ListReleaseAssets(ctx, apiConf.User, apiConf.Repo, releaseID, opt)
+		if err != nil {
+			return nil, err
+		}
+
+		allAssets = append(allAssets, assets...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
 	}
 
-	if stat.IsDir() {
-		return errors.New("asset can't be a directory")
+	return allAssets, nil
+}
+
+func deleteReleaseAsset(ctx context.Context, apiConf GitHubApiConfig, assetID int64) error {
+	_, err := apiConf.Client.Repositories.DeleteReleaseAsset(ctx, apiConf.User, apiConf.Repo, assetID)
+	return err
+}
+
+// resolveAssetCollision checks whether an asset with the given name already
+// exists on the release and applies the configured file_exists policy. It
+// returns ok=false when the upload should be skipped.
+func resolveAssetCollision(ctx context.Context, apiConf GitHubApiConfig, release *github.RepositoryRelease, name string, policy string) (bool, error) {
+	assets, err := listReleaseAssets(ctx, apiConf, release.GetID())
+	if err != nil {
+		return false, err
 	}
 
-	uploadURL := apiConf.getUploadAssetURL(release.ID, filepath.Base(postAsset.Name()))
-	mediaType := mime.TypeByExtension(filepath.Ext(postAsset.Name()))
-	if mediaType == "" {
-		mediaType = defaultMediaType
+	for _, asset := range assets {
+		if asset.GetName() != name {
+			continue
+		}
+
+		switch policy {
+		case fileExistsSkip:
+			log.Warnf("Asset %s already exists, skipping upload", name)
+			return false, nil
+		case fileExistsFail, "":
+			return false, errors.New("asset already exists: " + name)
+		case fileExistsOverwrite:
+			log.Warnf("Asset %s already exists, deleting before re-upload", name)
+			if err := deleteReleaseAsset(ctx, apiConf, asset.GetID()); err != nil {
+				return false, err
+			}
+		default:
+			return false, errors.New("unknown file_exists policy: " + policy)
+		}
 	}
 
-	log.Infof("Posting asset to %s", uploadURL)
+	return true, nil
+}
+
+func postAsset(ctx context.Context, apiConf GitHubApiConfig, release *github.RepositoryRelease, assetPath string, policy string) (*github.ReleaseAsset, error) {
+	name := filepath.Base(assetPath)
 
-	hc := http.Client{}
-	req, err := http.NewRequest("POST", uploadURL, postAsset)
+	ok, err := resolveAssetCollision(ctx, apiConf, release, name, policy)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
 	}
 
-	req.ContentLength = stat.Size()
-	req.Header.Set("Content-Type", mediaType)
-	resp, err := hc.Do(req)
+	file, err := os.Open(assetPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if resp.StatusCode != 201 {
-		return errors.New("fileupload failed with " + resp.Status)
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	if stat.IsDir() {
+		return nil, errors.New("asset can't be a directory")
+	}
+
+	log.Infof("Uploading asset %s to release %d", name, release.GetID())
 
-func postRelease(url string, release *GitHubRelease) error {
-	jsonRelease, err := json.Marshal(release)
+	asset, _, err := apiConf.Client.Repositories.UploadReleaseAsset(ctx, apiConf.User, apiConf.Repo, release.GetID(), &github.UploadOptions{Name: name}, file)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	log.Printf(string(jsonRelease))
 
-	log.Infof("Posting Release to: %v", url)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonRelease))
+	return asset, nil
+}
+
+// getReleaseByTag looks up the release for the given tag. It returns a nil
+// release (and no error) when GitHub reports no release exists for the tag.
+func getReleaseByTag(ctx context.Context, apiConf GitHubApiConfig, tag string) (*github.RepositoryRelease, error) {
+	release, resp, err := apiConf.Client.Repositories.GetReleaseByTag(ctx, apiConf.User, apiConf.Repo, tag)
 	if err != nil {
-		return err
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 201 {
-		return errors.New("GitHub API could not create release")
-	}
+	return release, nil
+}
+
+func postRelease(ctx context.Context, apiConf GitHubApiConfig, release *github.RepositoryRelease) (*github.RepositoryRelease, error) {
+	log.Infof("Creating release for tag %s", release.GetTagName())
 
-	body, err := ioutil.ReadAll(resp.Body)
+	created, _, err := apiConf.Client.Repositories.CreateRelease(ctx, apiConf.User, apiConf.Repo, release)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = json.Unmarshal(body, &release)
+	return created, nil
+}
+
+func patchRelease(ctx context.Context, apiConf GitHubApiConfig, releaseID int64, release *github.RepositoryRelease) (*github.RepositoryRelease, error) {
+	log.Infof("Updating release %d", releaseID)
+
+	updated, _, err := apiConf.Client.Repositories.EditRelease(ctx, apiConf.User, apiConf.Repo, releaseID, release)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return updated, nil
 }
 
 func main() {
+	ctx := context.Background()
 
 	config := createConfigsModelFromEnvs()
 	config.print()
 
+	if shouldRunOnlyOnTag(config) && resolveTagEvent() == "" {
+		log.Warnf("Build was not triggered by a tag, skipping release (only_on_tag)")
+		os.Exit(0)
+	}
+
 	gitHubAPIConfig, err := inferGithubAPIConfig(config)
 	if err != nil {
 		failf("Failed to infer GitHub API config")
 	}
 	gitHubAPIConfig.print()
 
-	releaseNotes := collectReleaseNotes(config.ChangelogFileList)
+	var releaseNotes string
+	switch {
+	case config.ChangelogFileList != "":
+		releaseNotes = collectReleaseNotes(config.ChangelogFileList)
+	case config.ChangelogMode == changelogModeGit:
+		releaseNotes, err = generateChangelog(config)
+		if err != nil {
+			log.Warnf("Failed to generate changelog, falling back to empty release notes: %v", err)
+			releaseNotes = ""
+		}
+	}
+
+	release := createRelease(config, releaseNotes, resolveIsPrerelease(config))
 
-	release := createRelease(config, releaseNotes)
-	err = postRelease(gitHubAPIConfig.getCreateReleasesURL(), &release)
-	if err != nil {
-		failf("Failed to create Github release entry with error: %v", err)
+	var existingRelease *github.RepositoryRelease
+	if config.UpdateExisting {
+		existingRelease, err = getReleaseByTag(ctx, gitHubAPIConfig, config.ReleaseTag)
+		if err != nil {
+			failf("Failed to look up existing release for tag %s: %v", config.ReleaseTag, err)
+		}
 	}
 
-	if config.UploadAssetFile != "" {
-		uploadFile, err := os.Open(config.UploadAssetFile)
+	var result *github.RepositoryRelease
+	if existingRelease != nil {
+		result, err = patchRelease(ctx, gitHubAPIConfig, existingRelease.GetID(), &release)
 		if err != nil {
-			log.Errorf("%v", err)
-		} else {
-			err = postAsset(gitHubAPIConfig, &release, uploadFile)
+			failf("Failed to update existing Github release entry with error: %v", err)
+		}
+	} else {
+		result, err = postRelease(ctx, gitHubAPIConfig, &release)
+		if err != nil {
+			failf("Failed to create Github release entry with error: %v", err)
+		}
+	}
+
+	var assetURLs []string
+	if config.UploadAssetFiles != "" {
+		assetPaths, err := resolveAssetPaths(config.UploadAssetFiles)
+		if err != nil {
+			failf("Failed to resolve upload_asset_file patterns: %v", err)
+		}
+
+		if config.Checksum != "" {
+			algos, err := parseChecksumAlgos(config.Checksum)
+			if err != nil {
+				failf("Failed to parse checksum input: %v", err)
+			}
+
+			checksumFiles, err := writeChecksumFiles(assetPaths, algos)
+			if err != nil {
+				failf("Failed to generate checksum files: %v", err)
+			}
+
+			assetPaths = append(assetPaths, checksumFiles...)
+		}
+
+		for _, assetPath := range assetPaths {
+			asset, err := postAsset(ctx, gitHubAPIConfig, result, assetPath, config.FileExists)
 			if err != nil {
-				log.Errorf("%v", err)
+				failf("Failed to upload asset %s: %v", assetPath, err)
+			}
+			if asset != nil {
+				assetURLs = append(assetURLs, asset.GetBrowserDownloadURL())
 			}
 		}
 	}
 
-	cmdLog, err := exec.Command("bitrise", "envman", "add", "--key", "RELEASE_URL", "--value", release.HTMLURL).CombinedOutput()
+	cmdLog, err := exec.Command("bitrise", "envman", "add", "--key", "RELEASE_URL", "--value", result.GetHTMLURL()).CombinedOutput()
 	if err != nil {
 		failf("Failed to expose output with envman, error: %#v | output: %s", err, cmdLog)
 	}
 
+	cmdLog, err = exec.Command("bitrise", "envman", "add", "--key", "RELEASE_NOTES", "--value", releaseNotes).CombinedOutput()
+	if err != nil {
+		failf("Failed to expose output with envman, error: %#v | output: %s", err, cmdLog)
+	}
+
+	if len(assetURLs) > 0 {
+		cmdLog, err = exec.Command("bitrise", "envman", "add", "--key", "RELEASE_ASSET_URLS", "--value", strings.Join(assetURLs, "|")).CombinedOutput()
+		if err != nil {
+			failf("Failed to expose output with envman, error: %#v | output: %s", err, cmdLog)
+		}
+	}
 }
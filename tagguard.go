@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"regexp"
+)
+
+// semverRegexp matches a (optionally "v"-prefixed) semantic version and
+// captures its pre-release identifier, e.g. "rc.1" in "v1.2.3-rc.1".
+var semverRegexp = regexp.MustCompile(`^v?\d+\.\d+\.\d+(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// resolveTagEvent reports the tag this build ran against, checking the
+// exposed Bitrise env vars in order of specificity.
+func resolveTagEvent() string {
+	if tag := os.Getenv("BITRISE_GIT_TAG"); tag != "" {
+		return tag
+	}
+	return os.Getenv("GIT_TAG")
+}
+
+// shouldRunOnlyOnTag reports whether the step should no-op when the build
+// wasn't triggered by a tag. Defaults to true unless explicitly disabled.
+func shouldRunOnlyOnTag(config ConfigModel) bool {
+	return config.OnlyOnTag != "false"
+}
+
+// isSemverPrerelease reports whether tag parses as a semantic version with a
+// pre-release identifier (e.g. "-rc.1", "-beta").
+func isSemverPrerelease(tag string) bool {
+	match := semverRegexp.FindStringSubmatch(tag)
+	return match != nil && match[1] != ""
+}
+
+// resolveIsPrerelease honors an explicit is_prerelease input and otherwise
+// auto-detects prerelease status from the release tag's semver identifier.
+func resolveIsPrerelease(config ConfigModel) bool {
+	if config.IsPrerelease != "" {
+		return config.IsPrerelease == "true"
+	}
+	return isSemverPrerelease(config.ReleaseTag)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestIsSemverPrerelease(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{tag: "v1.2.3", want: false},
+		{tag: "1.2.3", want: false},
+		{tag: "v1.2.3-rc.1", want: true},
+		{tag: "v1.2.3-beta", want: true},
+		{tag: "1.2.3+build.5", want: false},
+		{tag: "v1.2.3-rc.1+build.5", want: true},
+		{tag: "not-a-version", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isSemverPrerelease(tt.tag); got != tt.want {
+			t.Errorf("isSemverPrerelease(%q) = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}